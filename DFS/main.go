@@ -2,10 +2,16 @@ package main
 
 import (
 	"bytes"
+	"container/list"
+	"context"
 	crypto "crypto/rand"
+	"crypto/sha256"
 	"encoding/binary"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"hash"
 	"io"
 	"log"
 	"math/rand"
@@ -17,13 +23,62 @@ import (
 	"sync"
 	"time"
 
+	"distributed-file-system/dfserror"
 	"distributed-file-system/goraft"
 )
 
+const (
+	// uploadSessionIdleTimeout is how long a resumable upload session can go
+	// without a PATCH before the idle reaper cleans it up.
+	uploadSessionIdleTimeout = 30 * time.Minute
+	uploadReapInterval       = 5 * time.Minute
+
+	// chunkSize is the fixed size each stored file is split into for the
+	// content-addressable blob store, aside from the final, shorter chunk.
+	chunkSize = 1 << 20 // 1 MiB
+
+	// chunkCacheCapacityBytes bounds the total size of the in-memory chunk
+	// read cache, shared across all files on this node.
+	chunkCacheCapacityBytes = 256 << 20 // 256 MiB
+
+	// perFileCacheCapacityBytes bounds how many bytes of a single file's
+	// chunks a single getFileHandler call will insert into the cache, so
+	// one large streamed file can't evict every other file's hot chunks.
+	perFileCacheCapacityBytes = 16 << 20 // 16 MiB
+
+	// replicationFlushBytes bounds how much of a chunk is written to disk at
+	// once, so a slow disk releases write capacity incrementally rather than
+	// holding a whole chunk's write behind one large syscall.
+	replicationFlushBytes = 256 << 10 // 256 KiB
+
+	// blobFetchTimeout bounds how long read-repair and anti-entropy wait for
+	// peers to answer a GET /blobs/{hash} request.
+	blobFetchTimeout = 5 * time.Second
+
+	// antiEntropyInterval is how often a non-leader node compares its state
+	// machine's files against its local blob store and repairs any gaps.
+	antiEntropyInterval = 30 * time.Second
+
+	// chunkFeedDepth bounds how many just-hashed chunks ingestAndReplicate
+	// will queue for a single follower before a slow follower's query/send
+	// pace starts applying backpressure to the ingest loop.
+	chunkFeedDepth = 4
+)
+
 type File struct {
 	Name         string    `json:"name"`
 	Size         int64     `json:"size"`
 	LastModified time.Time `json:"last_modified"`
+	// Chunks is the ordered manifest of content hashes making up this file,
+	// each stored as a blob under dataDir/blobs/<hash[:2]>/<hash>.
+	Chunks []string `json:"chunks"`
+}
+
+// Dir is a directory marker stored in the same namespace as File, so paths
+// can be listed and traversed hierarchically instead of as opaque keys.
+type Dir struct {
+	Name         string    `json:"name"`
+	LastModified time.Time `json:"last_modified"`
 }
 
 type DFSStateMachine struct {
@@ -44,22 +99,105 @@ func (s *DFSStateMachine) Apply(cmd []byte) ([]byte, error) {
 			Name:         c.Path,
 			Size:         c.Size,
 			LastModified: time.Now(),
+			Chunks:       bytesChunksToHex(c.Chunks),
 		})
-		log.Printf("Applied CreateFile: %s (%d bytes)", c.Path, c.Size)
+		log.Printf("Applied CreateFile: %s (%d bytes, %d chunks)", c.Path, c.Size, len(c.Chunks))
 
 	case DeleteFile:
 		s.files.Delete(c.Path)
 		log.Printf("Applied DeleteFile: %s", c.Path)
 
 	case RenameFile:
+		var chunks []string
+		if old, ok := s.files.Load(c.OldPath); ok {
+			chunks = old.(*File).Chunks
+		}
 		s.files.Delete(c.OldPath)
 		s.files.Store(c.NewPath, &File{
 			Name:         c.NewPath,
 			Size:         c.Size,
 			LastModified: time.Now(),
+			Chunks:       chunks,
 		})
 		log.Printf("Applied RenameFile: %s -> %s", c.OldPath, c.NewPath)
 
+	case MkDir:
+		s.files.Store(c.Path, &Dir{Name: c.Path, LastModified: time.Now()})
+		log.Printf("Applied MkDir: %s", c.Path)
+
+	case RmDir:
+		s.files.Delete(c.Path)
+		log.Printf("Applied RmDir: %s", c.Path)
+
+	case CopyFile:
+		s.files.Store(c.NewPath, &File{
+			Name:         c.NewPath,
+			Size:         c.Size,
+			LastModified: time.Now(),
+			Chunks:       bytesChunksToHex(c.Chunks),
+		})
+		log.Printf("Applied CopyFile: %s -> %s", c.OldPath, c.NewPath)
+
+	case CopyDir:
+		// The state machine is identical across replicas at the point each of
+		// them applies this command, so walking the current tree here and
+		// re-keying it under NewPath is deterministic. Manifests are just
+		// re-pointed at existing chunk hashes - no blob bytes are duplicated.
+		prefix := c.OldPath + "/"
+		var toCopy []string
+		s.files.Range(func(key, _ interface{}) bool {
+			p := key.(string)
+			if p == c.OldPath || strings.HasPrefix(p, prefix) {
+				toCopy = append(toCopy, p)
+			}
+			return true
+		})
+		for _, p := range toCopy {
+			newPath := c.NewPath + strings.TrimPrefix(p, c.OldPath)
+			val, _ := s.files.Load(p)
+			switch v := val.(type) {
+			case *File:
+				s.files.Store(newPath, &File{Name: newPath, Size: v.Size, LastModified: time.Now(), Chunks: v.Chunks})
+			case *Dir:
+				s.files.Store(newPath, &Dir{Name: newPath, LastModified: time.Now()})
+			}
+		}
+		if _, ok := s.files.Load(c.NewPath); !ok {
+			s.files.Store(c.NewPath, &Dir{Name: c.NewPath, LastModified: time.Now()})
+		}
+		log.Printf("Applied CopyDir: %s -> %s", c.OldPath, c.NewPath)
+
+	case MoveDir:
+		// Like CopyDir, but re-keys and deletes each entry in the same pass
+		// instead of copying first and cleaning up the old subtree in
+		// separate, later commands - so a directory move is one atomic step
+		// in the log rather than N+1, and nothing created under OldPath
+		// between two commands can be missed by a stale snapshot.
+		prefix := c.OldPath + "/"
+		var toMove []string
+		s.files.Range(func(key, _ interface{}) bool {
+			p := key.(string)
+			if p == c.OldPath || strings.HasPrefix(p, prefix) {
+				toMove = append(toMove, p)
+			}
+			return true
+		})
+		for _, p := range toMove {
+			newPath := c.NewPath + strings.TrimPrefix(p, c.OldPath)
+			val, _ := s.files.Load(p)
+			switch v := val.(type) {
+			case *File:
+				s.files.Store(newPath, &File{Name: newPath, Size: v.Size, LastModified: time.Now(), Chunks: v.Chunks})
+			case *Dir:
+				s.files.Store(newPath, &Dir{Name: newPath, LastModified: time.Now()})
+			}
+			s.files.Delete(p)
+		}
+		if _, ok := s.files.Load(c.NewPath); !ok {
+			s.files.Store(c.NewPath, &Dir{Name: c.NewPath, LastModified: time.Now()})
+		}
+		log.Printf("Applied MoveDir: %s -> %s", c.OldPath, c.NewPath)
+
 	default:
 		return nil, fmt.Errorf("unknown command: %v", c.Kind)
 	}
@@ -72,6 +210,11 @@ const (
 	CreateFile commandKind = iota
 	DeleteFile
 	RenameFile
+	MkDir
+	RmDir
+	CopyFile
+	CopyDir
+	MoveDir
 )
 
 type command struct {
@@ -80,6 +223,10 @@ type command struct {
 	OldPath string
 	NewPath string
 	Size    int64
+	// Chunks is the ordered manifest of raw content-hash bytes for this
+	// command's file, so the Raft log replicates manifests rather than
+	// raw file bytes.
+	Chunks [][]byte
 }
 
 func encodeCommand(c command) []byte {
@@ -97,6 +244,12 @@ func encodeCommand(c command) []byte {
 
 	binary.Write(msg, binary.LittleEndian, uint64(c.Size))
 
+	binary.Write(msg, binary.LittleEndian, uint64(len(c.Chunks)))
+	for _, chunk := range c.Chunks {
+		binary.Write(msg, binary.LittleEndian, uint64(len(chunk)))
+		msg.Write(chunk)
+	}
+
 	return msg.Bytes()
 }
 
@@ -119,13 +272,177 @@ func decodeCommand(msg []byte) command {
 	binary.Read(buf, binary.LittleEndian, &size)
 	c.Size = int64(size)
 
+	var numChunks uint64
+	binary.Read(buf, binary.LittleEndian, &numChunks)
+	c.Chunks = make([][]byte, numChunks)
+	for i := range c.Chunks {
+		var chunkLen uint64
+		binary.Read(buf, binary.LittleEndian, &chunkLen)
+		chunk := make([]byte, chunkLen)
+		copy(chunk, buf.Next(int(chunkLen)))
+		c.Chunks[i] = chunk
+	}
+
 	return c
 }
 
+// hexChunksToBytes decodes a manifest's hex chunk hashes into the raw bytes
+// the Raft log replicates.
+func hexChunksToBytes(hexes []string) ([][]byte, error) {
+	out := make([][]byte, len(hexes))
+	for i, h := range hexes {
+		b, err := hex.DecodeString(h)
+		if err != nil {
+			return nil, fmt.Errorf("decoding chunk hash %q: %w", h, err)
+		}
+		out[i] = b
+	}
+	return out, nil
+}
+
+// bytesChunksToHex encodes a command's raw chunk hash bytes back into the
+// hex manifest form stored on File.
+func bytesChunksToHex(chunks [][]byte) []string {
+	out := make([]string, len(chunks))
+	for i, b := range chunks {
+		out[i] = hex.EncodeToString(b)
+	}
+	return out
+}
+
 type httpServer struct {
 	raft         *goraft.Server
 	stateMachine *DFSStateMachine
 	dataDir      string
+
+	// peers is every other node in the cluster, used for read-repair and
+	// anti-entropy fetches that aren't scoped to leader/follower roles.
+	peers []goraft.ClusterMember
+
+	// uploadSessions tracks in-progress resumable uploads, keyed by upload UUID.
+	uploadSessions *sync.Map
+
+	// chunkCache is an in-memory LRU of decoded blob chunks, so hot files
+	// can be served from RAM instead of always hitting disk.
+	chunkCache *chunkCache
+
+	// repair tracks read-repair and anti-entropy activity for /repair/status.
+	repair *repairStats
+}
+
+// peerAddresses returns this node's peer HTTP addresses, comma-separated.
+// goraft.Server doesn't expose which peer is currently the leader to a
+// follower, so this is the best candidate list a NotLeader error can offer a
+// client to retry against.
+func (hs *httpServer) peerAddresses() string {
+	addrs := make([]string, len(hs.peers))
+	for i, p := range hs.peers {
+		addrs[i] = p.HttpAddress
+	}
+	return strings.Join(addrs, ",")
+}
+
+// repairStats tracks how many chunks are currently known to be missing
+// locally and when repair activity last ran or last fixed something.
+type repairStats struct {
+	mu           sync.Mutex
+	pending      int
+	lastRunAt    time.Time
+	lastRepairAt time.Time
+}
+
+func (rs *repairStats) recordRun(pending int) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	rs.pending = pending
+	rs.lastRunAt = time.Now()
+}
+
+func (rs *repairStats) recordRepair() {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	if rs.pending > 0 {
+		rs.pending--
+	}
+	rs.lastRepairAt = time.Now()
+}
+
+func (rs *repairStats) snapshot() (pending int, lastRunAt, lastRepairAt time.Time) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	return rs.pending, rs.lastRunAt, rs.lastRepairAt
+}
+
+// chunkCache is a byte-size-bounded LRU cache of chunk store blobs, keyed by
+// content hash.
+type chunkCache struct {
+	mu       sync.Mutex
+	capacity int64
+	size     int64
+	ll       *list.List
+	items    map[string]*list.Element
+}
+
+type chunkCacheEntry struct {
+	hash string
+	data []byte
+}
+
+func newChunkCache(capacity int64) *chunkCache {
+	return &chunkCache{
+		capacity: capacity,
+		ll:       list.New(),
+		items:    make(map[string]*list.Element),
+	}
+}
+
+func (c *chunkCache) get(hash string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.items[hash]
+	if !ok {
+		return nil, false
+	}
+	c.ll.MoveToFront(el)
+	return el.Value.(*chunkCacheEntry).data, true
+}
+
+func (c *chunkCache) put(hash string, data []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.items[hash]; ok {
+		c.ll.MoveToFront(el)
+		return
+	}
+
+	el := c.ll.PushFront(&chunkCacheEntry{hash: hash, data: data})
+	c.items[hash] = el
+	c.size += int64(len(data))
+
+	for c.size > c.capacity {
+		back := c.ll.Back()
+		if back == nil {
+			break
+		}
+		entry := back.Value.(*chunkCacheEntry)
+		c.ll.Remove(back)
+		delete(c.items, entry.hash)
+		c.size -= int64(len(entry.data))
+	}
+}
+
+// uploadSession tracks the staging state of a single resumable (PATCH-based)
+// upload, following the Docker-Registry two-phase upload protocol.
+type uploadSession struct {
+	id          string
+	path        string
+	stagingPath string
+
+	mu         sync.Mutex
+	received   int64
+	lastActive time.Time
 }
 
 func (hs *httpServer) statusHandler(w http.ResponseWriter, r *http.Request) {
@@ -141,10 +458,22 @@ func (hs *httpServer) statusHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(status)
 }
 
+// listFilesHandler answers GET /files with every file this node's state
+// machine knows about. An optional ?prefix= query scopes the listing to a
+// subtree instead of the whole namespace.
 func (hs *httpServer) listFilesHandler(w http.ResponseWriter, r *http.Request) {
+	prefix := r.URL.Query().Get("prefix")
+
 	var files []File
 	hs.stateMachine.files.Range(func(key, value interface{}) bool {
-		files = append(files, *value.(*File))
+		file, ok := value.(*File)
+		if !ok {
+			return true // directory marker
+		}
+		if prefix != "" && !strings.HasPrefix(file.Name, prefix) {
+			return true
+		}
+		files = append(files, *file)
 		return true
 	})
 
@@ -152,229 +481,1364 @@ func (hs *httpServer) listFilesHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(files)
 }
 
+// blobPath returns where a chunk with the given hex content hash is stored
+// under dataDir, sharded by its first byte to keep any one directory small.
+// Callers must validate hash with isValidChunkHash first; this assumes a
+// well-formed sha256 hex digest and will panic on anything shorter.
+func blobPath(dataDir, hash string) string {
+	return filepath.Join(dataDir, "blobs", hash[:2], hash)
+}
+
+// isValidChunkHash reports whether hash looks like a sha256 hex digest, as
+// produced by writeChunk. Handlers that accept a hash from a request must
+// check this before passing it to blobPath/chunkExists, which slice into it
+// assuming this shape.
+func isValidChunkHash(hash string) bool {
+	if len(hash) != sha256.Size*2 {
+		return false
+	}
+	for _, c := range hash {
+		if !strings.ContainsRune("0123456789abcdef", c) {
+			return false
+		}
+	}
+	return true
+}
+
+func chunkExists(dataDir, hash string) bool {
+	_, err := os.Stat(blobPath(dataDir, hash))
+	return err == nil
+}
+
+// writeChunk stores data under its content hash if not already present,
+// giving dedup across renames and repeated uploads for free.
+func writeChunk(dataDir string, data []byte) (string, error) {
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+
+	path := blobPath(dataDir, hash)
+	if _, err := os.Stat(path); err == nil {
+		return hash, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", err
+	}
+
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return "", err
+	}
+
+	// Flush to disk in bounded pieces rather than one large write, the same
+	// "release capacity as it arrives" pattern replication uses on the wire.
+	for off := 0; off < len(data); off += replicationFlushBytes {
+		end := off + replicationFlushBytes
+		if end > len(data) {
+			end = len(data)
+		}
+		if _, err := f.Write(data[off:end]); err != nil {
+			f.Close()
+			return "", err
+		}
+	}
+	if err := f.Close(); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return "", err
+	}
+	return hash, nil
+}
+
+func readChunk(dataDir, hash string) ([]byte, error) {
+	return os.ReadFile(blobPath(dataDir, hash))
+}
+
+// splitAndStoreChunks reads r in chunkSize pieces, storing each in the CAS
+// blob store and returning the ordered hash manifest plus total size.
+func splitAndStoreChunks(dataDir string, r io.Reader) (manifest []string, size int64, err error) {
+	return splitAndStoreChunksWithCallback(dataDir, r, nil)
+}
+
+// splitAndStoreChunksWithCallback behaves like splitAndStoreChunks, additionally
+// invoking onChunk with each chunk's hash as soon as it's stored, before the
+// next chunk is read - so a caller can act on a chunk (e.g. replicate it)
+// while the rest of r is still arriving.
+func splitAndStoreChunksWithCallback(dataDir string, r io.Reader, onChunk func(hash string)) (manifest []string, size int64, err error) {
+	buf := make([]byte, chunkSize)
+	for {
+		n, rerr := io.ReadFull(r, buf)
+		if n > 0 {
+			hash, werr := writeChunk(dataDir, buf[:n])
+			if werr != nil {
+				return nil, 0, werr
+			}
+			manifest = append(manifest, hash)
+			size += int64(n)
+			if onChunk != nil {
+				onChunk(hash)
+			}
+		}
+		if rerr == io.EOF || rerr == io.ErrUnexpectedEOF {
+			break
+		}
+		if rerr != nil {
+			return nil, 0, rerr
+		}
+	}
+	return manifest, size, nil
+}
+
 func (hs *httpServer) createFileHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		dfserror.Respond(w, dfserror.MethodNotAllowed, "")
 		return
 	}
 
 	if !hs.raft.IsLeader() {
-		http.Error(w, "Not the leader - try another node", http.StatusServiceUnavailable)
+		dfserror.Respond(w, dfserror.NotLeader, hs.peerAddresses())
 		return
 	}
 
 	filePath := strings.TrimPrefix(r.URL.Path, "/upload/")
 	log.Printf("Received CreateFile request for %s", filePath)
 
-	dataFilePath := filepath.Join(hs.dataDir, filepath.Base(filePath))
-	file, err := os.Create(dataFilePath)
-	if err != nil {
-		http.Error(w, "Failed to create local file", http.StatusInternalServerError)
+	if hs.typeConflict(filePath, false) {
+		dfserror.Respond(w, dfserror.Conflict, "path already exists as a directory")
 		return
 	}
-	defer file.Close()
 
-	// We need to read the body to a buffer first so we can both save it
-	// and forward it to followers.
-	body, err := io.ReadAll(r.Body)
-	n, err := file.Write(body)
+	manifest, size, err := hs.ingestAndReplicate(filePath, r.Body)
+	if err != nil {
+		dfserror.Respond(w, dfserror.Internal, err.Error())
+		return
+	}
 
+	chunkBytes, err := hexChunksToBytes(manifest)
 	if err != nil {
-		http.Error(w, "Failed to write file content", http.StatusInternalServerError)
+		dfserror.Respond(w, dfserror.Internal, err.Error())
 		return
 	}
 
 	cmd := command{
-		Kind: CreateFile,
-		Path: filePath,
-		Size: int64(n),
+		Kind:   CreateFile,
+		Path:   filePath,
+		Size:   size,
+		Chunks: chunkBytes,
 	}
 
 	_, err = hs.raft.Apply([][]byte{encodeCommand(cmd)})
 	if err != nil {
 		log.Printf("Raft Apply error: %s", err)
-		http.Error(w, "Failed to replicate file metadata", http.StatusInternalServerError)
+		dfserror.Respond(w, dfserror.Internal, err.Error())
 		return
 	}
 
-	// After metadata is committed, replicate the file content to followers
-	hs.replicateToFollowers(filePath, body)
-
 	w.WriteHeader(http.StatusCreated)
-	fmt.Fprintf(w, "File '%s' created and replicated successfully (%d bytes)", filePath, n)
+	fmt.Fprintf(w, "File '%s' created and replicated successfully (%d bytes)", filePath, size)
 }
 
-func (hs *httpServer) replicateToFollowers(filePath string, data []byte) {
-	followers := hs.raft.Followers()
-	if len(followers) == 0 {
-		log.Println("No followers to replicate to.")
-		return
+// dirHandler dispatches the WebDAV-ish verbs that operate on /dirs/{path}:
+// MKCOL to create a directory, DELETE to remove an empty one.
+func (hs *httpServer) dirHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "MKCOL":
+		hs.mkdirHandler(w, r)
+	case http.MethodDelete:
+		hs.rmdirHandler(w, r)
+	default:
+		dfserror.Respond(w, dfserror.MethodNotAllowed, "")
 	}
+}
 
-	var wg sync.WaitGroup
-	for _, follower := range followers {
-		wg.Add(1)
-		go func(follower goraft.ClusterMember) {
-			defer wg.Done()
-			url := fmt.Sprintf("http://%s/replicate/%s", follower.HttpAddress, filePath)
-			req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(data))
-			if err != nil {
-				log.Printf("Error creating replication request for %s: %v", follower.HttpAddress, err)
-				return
-			}
-			req.Header.Set("Content-Type", "application/octet-stream")
+func (hs *httpServer) mkdirHandler(w http.ResponseWriter, r *http.Request) {
+	if !hs.raft.IsLeader() {
+		dfserror.Respond(w, dfserror.NotLeader, hs.peerAddresses())
+		return
+	}
 
-			client := &http.Client{Timeout: 10 * time.Second}
-			resp, err := client.Do(req)
-			if err != nil {
-				log.Printf("Error replicating to %s: %v", follower.HttpAddress, err)
-				return
-			}
-			defer resp.Body.Close()
+	dirPath := strings.TrimPrefix(r.URL.Path, "/dirs/")
+	if dirPath == "" {
+		dfserror.Respond(w, dfserror.BadRequest, "missing directory path")
+		return
+	}
+	if _, exists := hs.stateMachine.files.Load(dirPath); exists {
+		dfserror.Respond(w, dfserror.Conflict, "path already exists")
+		return
+	}
 
-			log.Printf("Successfully replicated %s to node %d at %s (Status: %s)", filepath.Base(filePath), follower.Id, follower.HttpAddress, resp.Status)
-		}(follower)
+	cmd := command{Kind: MkDir, Path: dirPath}
+	if _, err := hs.raft.Apply([][]byte{encodeCommand(cmd)}); err != nil {
+		log.Printf("Raft Apply error: %s", err)
+		dfserror.Respond(w, dfserror.Internal, err.Error())
+		return
 	}
 
-	wg.Wait()
+	w.WriteHeader(http.StatusCreated)
+	fmt.Fprintf(w, "Directory '%s' created", dirPath)
 }
 
-func (hs *httpServer) getFileHandler(w http.ResponseWriter, r *http.Request) {
-	filePath := strings.TrimPrefix(r.URL.Path, "/upload/")
-	log.Printf("Received GetFile request for %s", filePath)
+func (hs *httpServer) rmdirHandler(w http.ResponseWriter, r *http.Request) {
+	if !hs.raft.IsLeader() {
+		dfserror.Respond(w, dfserror.NotLeader, hs.peerAddresses())
+		return
+	}
 
-	_, ok := hs.stateMachine.files.Load(filePath)
+	dirPath := strings.TrimPrefix(r.URL.Path, "/dirs/")
+	val, ok := hs.stateMachine.files.Load(dirPath)
 	if !ok {
-		http.Error(w, "File not found", http.StatusNotFound)
+		dfserror.Respond(w, dfserror.FileNotFound, dirPath)
 		return
 	}
-
-	dataFilePath := filepath.Join(hs.dataDir, filepath.Base(filePath))
-
-	if _, err := os.Stat(dataFilePath); os.IsNotExist(err) {
-		// This is a fallback. In a perfect scenario, this node should have the file.
-		// But if it doesn't for some reason, it can try to find it elsewhere.
-		// For this assignment, a simple error is sufficient.
-		http.Error(w, "File content not found on this node", http.StatusNotFound)
+	if _, isDir := val.(*Dir); !isDir {
+		dfserror.Respond(w, dfserror.BadRequest, "path is not a directory")
 		return
 	}
 
-	file, err := os.Open(dataFilePath)
-	if err != nil {
-		http.Error(w, "Could not open file on this node", http.StatusInternalServerError)
+	prefix := dirPath + "/"
+	empty := true
+	hs.stateMachine.files.Range(func(key, _ interface{}) bool {
+		if strings.HasPrefix(key.(string), prefix) {
+			empty = false
+			return false
+		}
+		return true
+	})
+	if !empty {
+		dfserror.Respond(w, dfserror.Conflict, "directory not empty")
 		return
 	}
-	defer file.Close()
 
-	w.Header().Set("Content-Type", "application/octet-stream")
-	io.Copy(w, file)
-}
-
-func (hs *httpServer) replicateFileHandler(w http.ResponseWriter, r *http.Request) {
-	filePath := strings.TrimPrefix(r.URL.Path, "/replicate/")
-	log.Printf("Received replication request for %s", filePath)
-
-	dataFilePath := filepath.Join(hs.dataDir, filepath.Base(filePath))
-	file, err := os.Create(dataFilePath)
-	if err != nil {
-		http.Error(w, "Failed to create local file for replication", http.StatusInternalServerError)
+	cmd := command{Kind: RmDir, Path: dirPath}
+	if _, err := hs.raft.Apply([][]byte{encodeCommand(cmd)}); err != nil {
+		log.Printf("Raft Apply error: %s", err)
+		dfserror.Respond(w, dfserror.Internal, err.Error())
 		return
 	}
-	defer file.Close()
 
-	io.Copy(file, r.Body)
 	w.WriteHeader(http.StatusOK)
-	fmt.Fprintf(w, "File replicated successfully")
+	fmt.Fprintf(w, "Directory '%s' removed", dirPath)
 }
 
-func (hs *httpServer) uploadHandler(w http.ResponseWriter, r *http.Request) {
-	switch r.Method {
-	case http.MethodGet:
-		hs.getFileHandler(w, r)
-	case http.MethodPost:
-		hs.createFileHandler(w, r)
-	default:
-		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
-	}
+// destinationPath reads the WebDAV Destination header off a COPY or MOVE
+// request and strips the /upload/ prefix clients address files through.
+func destinationPath(r *http.Request) string {
+	return strings.TrimPrefix(r.Header.Get("Destination"), "/upload/")
 }
 
-type config struct {
-	cluster []goraft.ClusterMember
-	index   int
-	http    string
+// typeConflict reports whether path already holds an entry of the opposite
+// type from wantDir (true for a directory, false for a file), mirroring the
+// existence check mkdirHandler does for MkDir. Handlers that store a File or
+// Dir at a caller-chosen path must check this first, since Apply stores
+// unconditionally and would otherwise silently orphan whatever used to live
+// under the other type.
+func (hs *httpServer) typeConflict(path string, wantDir bool) bool {
+	val, exists := hs.stateMachine.files.Load(path)
+	if !exists {
+		return false
+	}
+	_, isDir := val.(*Dir)
+	return isDir != wantDir
 }
 
-func getConfig() config {
-	cfg := config{}
-	var node string
+// copyHandler answers COPY /upload/{src} with a Destination: header. Files
+// are copied by pointing a new manifest at the existing chunk hashes, so the
+// copy is O(1) regardless of file size; directories are copied recursively
+// by the state machine in a single Raft command.
+func (hs *httpServer) copyHandler(w http.ResponseWriter, r *http.Request) {
+	if !hs.raft.IsLeader() {
+		dfserror.Respond(w, dfserror.NotLeader, hs.peerAddresses())
+		return
+	}
 
-	for i := 0; i < len(os.Args)-1; i++ {
-		arg := os.Args[i]
+	src := strings.TrimPrefix(r.URL.Path, "/upload/")
+	dest := destinationPath(r)
+	if dest == "" {
+		dfserror.Respond(w, dfserror.BadRequest, "missing Destination header")
+		return
+	}
 
-		if arg == "--node" {
-			var err error
-			node = os.Args[i+1]
-			cfg.index, err = strconv.Atoi(node)
-			if err != nil {
-				log.Fatalf("Expected integer for --node, got: %s", node)
-			}
-			i++
-			continue
-		}
+	val, ok := hs.stateMachine.files.Load(src)
+	if !ok {
+		dfserror.Respond(w, dfserror.FileNotFound, src)
+		return
+	}
 
-		if arg == "--http" {
-			cfg.http = os.Args[i+1]
-			i++
-			continue
+	var cmd command
+	switch v := val.(type) {
+	case *File:
+		if hs.typeConflict(dest, false) {
+			dfserror.Respond(w, dfserror.Conflict, "destination already exists as a directory")
+			return
 		}
-
-		if arg == "--cluster" {
-			cluster := os.Args[i+1]
-			for _, part := range strings.Split(cluster, ";") {
-				details := strings.Split(part, ",")
-				if len(details) != 3 {
-					log.Fatalf("Invalid cluster format. Expected: id,rpc_address,http_address")
-				}
-
-				var clusterEntry goraft.ClusterMember
-				var err error
-				clusterEntry.Id, err = strconv.ParseUint(details[0], 10, 64)
-				if err != nil {
-					log.Fatalf("Expected integer for cluster ID, got: %s", details[0])
-				}
-				clusterEntry.Address = details[1]
-				clusterEntry.HttpAddress = details[2]
-				cfg.cluster = append(cfg.cluster, clusterEntry)
-			}
-			i++
-			continue
+		chunkBytes, err := hexChunksToBytes(v.Chunks)
+		if err != nil {
+			dfserror.Respond(w, dfserror.Internal, err.Error())
+			return
+		}
+		cmd = command{Kind: CopyFile, OldPath: src, NewPath: dest, Size: v.Size, Chunks: chunkBytes}
+	case *Dir:
+		if hs.typeConflict(dest, true) {
+			dfserror.Respond(w, dfserror.Conflict, "destination already exists as a file")
+			return
 		}
+		cmd = command{Kind: CopyDir, OldPath: src, NewPath: dest}
 	}
 
-	if node == "" {
-		log.Fatal("Missing required parameter: --node <index>")
-	}
-	if cfg.http == "" {
-		log.Fatal("Missing required parameter: --http <address>")
-	}
-	if len(cfg.cluster) == 0 {
-		log.Fatal("Missing required parameter: --cluster <id1,addr1;id2,addr2;...>")
+	if _, err := hs.raft.Apply([][]byte{encodeCommand(cmd)}); err != nil {
+		log.Printf("Raft Apply error: %s", err)
+		dfserror.Respond(w, dfserror.Internal, err.Error())
+		return
 	}
 
-	return cfg
+	w.WriteHeader(http.StatusCreated)
+	fmt.Fprintf(w, "Copied '%s' to '%s'", src, dest)
 }
 
-func main() {
-	var b [8]byte
-	_, err := crypto.Read(b[:])
-	if err != nil {
-		panic("cannot seed math/rand package with cryptographically secure random number generator")
+// moveHandler answers MOVE /upload/{src} with a Destination: header. Moving
+// a file reuses the existing RenameFile command. Moving a directory submits a
+// single MoveDir command, which re-keys the whole subtree under its
+// destination and removes it from the source in one step.
+func (hs *httpServer) moveHandler(w http.ResponseWriter, r *http.Request) {
+	if !hs.raft.IsLeader() {
+		dfserror.Respond(w, dfserror.NotLeader, hs.peerAddresses())
+		return
 	}
-	rand.Seed(int64(binary.LittleEndian.Uint64(b[:])))
 
-	cfg := getConfig()
+	src := strings.TrimPrefix(r.URL.Path, "/upload/")
+	dest := destinationPath(r)
+	if dest == "" {
+		dfserror.Respond(w, dfserror.BadRequest, "missing Destination header")
+		return
+	}
 
-	// Create a unique data directory for each node
+	val, ok := hs.stateMachine.files.Load(src)
+	if !ok {
+		dfserror.Respond(w, dfserror.FileNotFound, src)
+		return
+	}
+
+	switch v := val.(type) {
+	case *File:
+		if hs.typeConflict(dest, false) {
+			dfserror.Respond(w, dfserror.Conflict, "destination already exists as a directory")
+			return
+		}
+		cmd := command{Kind: RenameFile, OldPath: src, NewPath: dest, Size: v.Size}
+		if _, err := hs.raft.Apply([][]byte{encodeCommand(cmd)}); err != nil {
+			log.Printf("Raft Apply error: %s", err)
+			dfserror.Respond(w, dfserror.Internal, err.Error())
+			return
+		}
+
+	case *Dir:
+		if hs.typeConflict(dest, true) {
+			dfserror.Respond(w, dfserror.Conflict, "destination already exists as a file")
+			return
+		}
+		// MoveDir re-keys and deletes the whole subtree in one Apply, so
+		// there's no window between a copy and a separate cleanup pass in
+		// which a concurrently created entry under src could be missed.
+		cmd := command{Kind: MoveDir, OldPath: src, NewPath: dest}
+		if _, err := hs.raft.Apply([][]byte{encodeCommand(cmd)}); err != nil {
+			log.Printf("Raft Apply error: %s", err)
+			dfserror.Respond(w, dfserror.Internal, err.Error())
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "Moved '%s' to '%s'", src, dest)
+}
+
+// propfindEntry is one row of a PROPFIND listing, covering both files and
+// directories since WebDAV clients expect a single namespace.
+type propfindEntry struct {
+	Path         string    `json:"path"`
+	IsDir        bool      `json:"is_dir"`
+	Size         int64     `json:"size,omitempty"`
+	LastModified time.Time `json:"last_modified"`
+}
+
+func toPropfindEntry(path string, value interface{}) propfindEntry {
+	switch v := value.(type) {
+	case *File:
+		return propfindEntry{Path: path, Size: v.Size, LastModified: v.LastModified}
+	case *Dir:
+		return propfindEntry{Path: path, IsDir: true, LastModified: v.LastModified}
+	default:
+		return propfindEntry{Path: path}
+	}
+}
+
+// propfindHandler answers PROPFIND /files/{path}?depth=N with a JSON listing
+// of the resource and, depending on depth, its children: "0" for just the
+// resource itself, "1" for its immediate children, anything else (including
+// the WebDAV default "infinity") for the full recursive subtree.
+func (hs *httpServer) propfindHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "PROPFIND" {
+		dfserror.Respond(w, dfserror.MethodNotAllowed, "")
+		return
+	}
+
+	dirPath := strings.TrimPrefix(r.URL.Path, "/files/")
+	depth := r.URL.Query().Get("depth")
+
+	var entries []propfindEntry
+	prefix := dirPath
+	if dirPath != "" {
+		val, ok := hs.stateMachine.files.Load(dirPath)
+		if !ok {
+			dfserror.Respond(w, dfserror.FileNotFound, dirPath)
+			return
+		}
+		entries = append(entries, toPropfindEntry(dirPath, val))
+		prefix += "/"
+	}
+
+	if depth != "0" {
+		hs.stateMachine.files.Range(func(key, value interface{}) bool {
+			p := key.(string)
+			if p == dirPath || !strings.HasPrefix(p, prefix) {
+				return true
+			}
+			rest := strings.TrimPrefix(p, prefix)
+			if depth == "1" && strings.Contains(rest, "/") {
+				return true // not an immediate child
+			}
+			entries = append(entries, toPropfindEntry(p, value))
+			return true
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
+
+type chunkMissingRequest struct {
+	Hashes []string `json:"hashes"`
+}
+
+type chunkMissingResponse struct {
+	Missing []string `json:"missing"`
+}
+
+// chunksMissingHandler answers POST /chunks/missing with the subset of the
+// requested hashes this node does not have stored locally.
+func (hs *httpServer) chunksMissingHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		dfserror.Respond(w, dfserror.MethodNotAllowed, "")
+		return
+	}
+
+	var req chunkMissingRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		dfserror.Respond(w, dfserror.BadRequest, "invalid request body")
+		return
+	}
+
+	var missing []string
+	for _, hash := range req.Hashes {
+		if !isValidChunkHash(hash) {
+			dfserror.Respond(w, dfserror.BadRequest, "invalid chunk hash: "+hash)
+			return
+		}
+		if !chunkExists(hs.dataDir, hash) {
+			missing = append(missing, hash)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(chunkMissingResponse{Missing: missing})
+}
+
+// blobFetchHandler answers GET /blobs/{hash} with the raw chunk bytes if this
+// node has it stored locally. Peers use this for read-repair and
+// anti-entropy; it never consults the chunk cache since it exists to serve
+// other nodes, not end users.
+func (hs *httpServer) blobFetchHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		dfserror.Respond(w, dfserror.MethodNotAllowed, "")
+		return
+	}
+
+	hash := strings.TrimPrefix(r.URL.Path, "/blobs/")
+	if !isValidChunkHash(hash) {
+		dfserror.Respond(w, dfserror.BadRequest, "invalid chunk hash: "+hash)
+		return
+	}
+	if !chunkExists(hs.dataDir, hash) {
+		dfserror.Respond(w, dfserror.ChunkMissing, hash)
+		return
+	}
+
+	data, err := readChunk(hs.dataDir, hash)
+	if err != nil {
+		log.Printf("Error reading chunk %s for blob fetch: %v", hash, err)
+		dfserror.Respond(w, dfserror.Internal, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Write(data)
+}
+
+// fetchChunkFromPeers asks every known peer for hash via GET /blobs/{hash}
+// and returns the bytes from whichever peer answers first, bounded by
+// blobFetchTimeout. It's used for both on-demand read-repair and the
+// background anti-entropy sweep.
+func (hs *httpServer) fetchChunkFromPeers(hash string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), blobFetchTimeout)
+	defer cancel()
+
+	type result struct {
+		data []byte
+		err  error
+	}
+	resCh := make(chan result, len(hs.peers))
+
+	for _, peer := range hs.peers {
+		go func(peer goraft.ClusterMember) {
+			url := fmt.Sprintf("http://%s/blobs/%s", peer.HttpAddress, hash)
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+			if err != nil {
+				resCh <- result{err: err}
+				return
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				resCh <- result{err: err}
+				return
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				resCh <- result{err: fmt.Errorf("peer %s returned %s", peer.HttpAddress, resp.Status)}
+				return
+			}
+			data, err := io.ReadAll(resp.Body)
+			resCh <- result{data: data, err: err}
+		}(peer)
+	}
+
+	var lastErr error = fmt.Errorf("no peers available for chunk %s", hash)
+	for range hs.peers {
+		select {
+		case res := <-resCh:
+			if res.err == nil {
+				return res.data, nil
+			}
+			lastErr = res.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	return nil, lastErr
+}
+
+// errDigestMismatch marks a replication attempt that the follower rejected
+// with 409 because its computed digest didn't match the trailer we sent.
+var errDigestMismatch = errors.New("follower reported chunk digest mismatch")
+
+const replicationTrailerKey = "X-Dfs-Expected-Sha256"
+
+// hashingTrailerReader tees reads through a hasher and, once the wrapped
+// reader reaches EOF, stamps the digest onto the outgoing request's Trailer.
+// This lets a streamed request body carry an integrity check that can only
+// be computed after the last byte has been read.
+type hashingTrailerReader struct {
+	r      io.Reader
+	hasher hash.Hash
+	req    *http.Request
+}
+
+func (h *hashingTrailerReader) Read(p []byte) (int, error) {
+	n, err := h.r.Read(p)
+	if n > 0 {
+		h.hasher.Write(p[:n])
+	}
+	if err == io.EOF {
+		h.req.Trailer.Set(replicationTrailerKey, hex.EncodeToString(h.hasher.Sum(nil)))
+	}
+	return n, err
+}
+
+// sendReplicationStream POSTs r to a follower's /replicate/{filePath}, using
+// chunked transfer encoding so the leader never has to know (or buffer) the
+// full body up front, and a trailer carrying the content's sha256 so the
+// follower can verify it only after streaming the whole thing in.
+func (hs *httpServer) sendReplicationStream(follower goraft.ClusterMember, filePath string, r io.Reader) error {
+	url := fmt.Sprintf("http://%s/replicate/%s", follower.HttpAddress, filePath)
+	req, err := http.NewRequest(http.MethodPost, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Trailer = http.Header{replicationTrailerKey: nil}
+	req.Body = io.NopCloser(&hashingTrailerReader{r: r, hasher: sha256.New(), req: req})
+
+	client := &http.Client{Timeout: 60 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusConflict:
+		return errDigestMismatch
+	default:
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("follower %s returned %s: %s", follower.HttpAddress, resp.Status, string(body))
+	}
+}
+
+type followerReplicationResult struct {
+	follower goraft.ClusterMember
+	err      error
+}
+
+// queryMissingChunks asks a follower which of manifest's chunks it doesn't
+// already have stored locally, via POST /chunks/missing.
+func (hs *httpServer) queryMissingChunks(follower goraft.ClusterMember, manifest []string) ([]string, error) {
+	reqBody, err := json.Marshal(chunkMissingRequest{Hashes: manifest})
+	if err != nil {
+		return nil, err
+	}
+
+	url := fmt.Sprintf("http://%s/chunks/missing", follower.HttpAddress)
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(reqBody))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var out chunkMissingResponse
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, err
+	}
+	return out.Missing, nil
+}
+
+// replicateMissingChunks asks follower which of manifest's chunks it's
+// missing and streams only those, read back from local CAS storage, so
+// content the follower already has (from a prior upload, a rename, or
+// anti-entropy) is never re-sent over the network. The missing chunks are
+// streamed through a pipe in manifest order, same as a full-file stream,
+// since each one is still a whole chunkSize-aligned unit.
+func (hs *httpServer) replicateMissingChunks(follower goraft.ClusterMember, filePath string, manifest []string) error {
+	missing, err := hs.queryMissingChunks(follower, manifest)
+	if err != nil {
+		return fmt.Errorf("querying missing chunks from %s: %w", follower.HttpAddress, err)
+	}
+	if len(missing) == 0 {
+		log.Printf("Follower %d at %s already has all chunks for %s", follower.Id, follower.HttpAddress, filePath)
+		return nil
+	}
+
+	missingSet := make(map[string]bool, len(missing))
+	for _, hash := range missing {
+		missingSet[hash] = true
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		for _, hash := range manifest {
+			if !missingSet[hash] {
+				continue
+			}
+			data, err := readChunk(hs.dataDir, hash)
+			if err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+			if _, err := pw.Write(data); err != nil {
+				return
+			}
+		}
+		pw.Close()
+	}()
+
+	return hs.sendReplicationStream(follower, filePath, pr)
+}
+
+// ingestAndReplicate reads body once, splitting it into CAS chunks locally.
+// As soon as a chunk is hashed and stored, it's offered to every follower
+// over that follower's own persistent stream, which forwards it only if the
+// follower doesn't already have it - so a chunk a follower holds from a
+// prior upload, rename, or anti-entropy is never re-sent, and a slow
+// follower's query/send pace stalls only its own stream (up to
+// chunkFeedDepth chunks of slack) rather than serializing ingest behind
+// replication. A follower whose stream fails outright is retried afterwards
+// from local storage.
+func (hs *httpServer) ingestAndReplicate(filePath string, body io.Reader) (manifest []string, size int64, err error) {
+	followers := hs.raft.Followers()
+	if len(followers) == 0 {
+		log.Println("No followers to replicate to.")
+		return splitAndStoreChunks(hs.dataDir, body)
+	}
+
+	feeds := make([]chan string, len(followers))
+	forwardDone := make([]chan struct{}, len(followers))
+	pipeWriters := make([]*io.PipeWriter, len(followers))
+	results := make(chan followerReplicationResult, len(followers))
+
+	for i, follower := range followers {
+		feed := make(chan string, chunkFeedDepth)
+		done := make(chan struct{})
+		pr, pw := io.Pipe()
+		feeds[i] = feed
+		forwardDone[i] = done
+		pipeWriters[i] = pw
+
+		go hs.forwardMissingChunks(follower, feed, pw, done)
+
+		go func(follower goraft.ClusterMember, pr *io.PipeReader) {
+			err := hs.sendReplicationStream(follower, filePath, pr)
+			pr.Close()
+			results <- followerReplicationResult{follower: follower, err: err}
+		}(follower, pr)
+	}
+
+	manifest, size, err = splitAndStoreChunksWithCallback(hs.dataDir, body, func(hash string) {
+		for _, feed := range feeds {
+			feed <- hash
+		}
+	})
+
+	for _, feed := range feeds {
+		close(feed)
+	}
+	for i := range followers {
+		<-forwardDone[i]
+		if err != nil {
+			pipeWriters[i].CloseWithError(err)
+		} else {
+			pipeWriters[i].Close()
+		}
+	}
+
+	if err != nil {
+		for range followers {
+			<-results
+		}
+		return nil, 0, err
+	}
+
+	for range followers {
+		res := <-results
+		if res.err == nil {
+			log.Printf("Successfully replicated %s to node %d at %s", filePath, res.follower.Id, res.follower.HttpAddress)
+			continue
+		}
+
+		log.Printf("Live replication of %s to %s failed, will retry from local storage: %v", filePath, res.follower.HttpAddress, res.err)
+		go hs.retryReplication(res.follower, filePath, manifest)
+	}
+
+	return manifest, size, nil
+}
+
+// forwardMissingChunks reads chunk hashes off feed as ingestAndReplicate
+// produces them and, for each one follower reports missing (or that it
+// couldn't be asked about), writes its bytes into pw. It closes done once
+// feed is drained (on a chunk read or pipe write error it keeps draining
+// feed without further network calls, so ingestAndReplicate's sends to feed
+// never block on a follower that's given up). Apart from closing pw with the
+// error when a chunk can't be read, it leaves closing pw to the caller once
+// done fires, so a chunk written concurrently with that close can't race it.
+func (hs *httpServer) forwardMissingChunks(follower goraft.ClusterMember, feed <-chan string, pw *io.PipeWriter, done chan<- struct{}) {
+	defer close(done)
+
+	failed := false
+	for hash := range feed {
+		if failed {
+			continue
+		}
+
+		missing, err := hs.queryMissingChunks(follower, []string{hash})
+		if err != nil {
+			log.Printf("Error querying %s for chunk %s, sending it anyway: %v", follower.HttpAddress, hash, err)
+			missing = []string{hash}
+		}
+		if len(missing) == 0 {
+			continue
+		}
+
+		data, err := readChunk(hs.dataDir, hash)
+		if err != nil {
+			pw.CloseWithError(err)
+			failed = true
+			continue
+		}
+		if _, err := pw.Write(data); err != nil {
+			failed = true
+		}
+	}
+}
+
+// retryReplication re-attempts missing-chunk-aware replication of filePath
+// to a follower that failed its first attempt, backing off exponentially
+// between tries.
+func (hs *httpServer) retryReplication(follower goraft.ClusterMember, filePath string, manifest []string) {
+	const maxAttempts = 5
+	backoff := 500 * time.Millisecond
+
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		time.Sleep(backoff)
+
+		if err := hs.replicateMissingChunks(follower, filePath, manifest); err != nil {
+			log.Printf("Retry %d/%d replicating %s to %s failed: %v", attempt, maxAttempts, filePath, follower.HttpAddress, err)
+			backoff *= 2
+			continue
+		}
+
+		log.Printf("Retry %d succeeded replicating %s to node %d at %s", attempt, filePath, follower.Id, follower.HttpAddress)
+		return
+	}
+
+	log.Printf("Giving up replicating %s to node %d at %s after %d attempts", filePath, follower.Id, follower.HttpAddress, maxAttempts)
+}
+
+// newUploadID generates a random UUID-like identifier for a resumable upload
+// session, reusing the same crypto/rand source main() uses to seed math/rand.
+func newUploadID() string {
+	var b [16]byte
+	if _, err := crypto.Read(b[:]); err != nil {
+		panic("cannot generate upload session id: " + err.Error())
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// parseContentRange parses a "start-end" or "start-end/total" Content-Range
+// value as sent by PATCH /uploads/{uuid} requests.
+func parseContentRange(header string) (start, end int64, err error) {
+	if header == "" {
+		return 0, 0, fmt.Errorf("missing Content-Range header")
+	}
+	spec := header
+	if idx := strings.Index(header, "/"); idx != -1 {
+		spec = header[:idx]
+	}
+	parts := strings.SplitN(spec, "-", 2)
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("malformed range %q", header)
+	}
+	if start, err = strconv.ParseInt(parts[0], 10, 64); err != nil {
+		return 0, 0, fmt.Errorf("malformed range start: %w", err)
+	}
+	if end, err = strconv.ParseInt(parts[1], 10, 64); err != nil {
+		return 0, 0, fmt.Errorf("malformed range end: %w", err)
+	}
+	return start, end, nil
+}
+
+func sha256File(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// startUploadHandler allocates a new resumable upload session for
+// POST /uploads/?path={filePath} and returns its location to the client.
+func (hs *httpServer) startUploadHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		dfserror.Respond(w, dfserror.MethodNotAllowed, "")
+		return
+	}
+
+	if !hs.raft.IsLeader() {
+		dfserror.Respond(w, dfserror.NotLeader, hs.peerAddresses())
+		return
+	}
+
+	targetPath := r.URL.Query().Get("path")
+	if targetPath == "" {
+		dfserror.Respond(w, dfserror.BadRequest, "missing required query parameter: path")
+		return
+	}
+
+	stagingDir := filepath.Join(hs.dataDir, ".uploads")
+	if err := os.MkdirAll(stagingDir, 0755); err != nil {
+		dfserror.Respond(w, dfserror.Internal, err.Error())
+		return
+	}
+
+	id := newUploadID()
+	stagingPath := filepath.Join(stagingDir, id)
+	file, err := os.Create(stagingPath)
+	if err != nil {
+		dfserror.Respond(w, dfserror.Internal, err.Error())
+		return
+	}
+	file.Close()
+
+	sess := &uploadSession{
+		id:          id,
+		path:        targetPath,
+		stagingPath: stagingPath,
+		lastActive:  time.Now(),
+	}
+	hs.uploadSessions.Store(id, sess)
+	log.Printf("Started upload session %s for %s", id, targetPath)
+
+	w.Header().Set("Location", fmt.Sprintf("/uploads/%s", id))
+	w.Header().Set("Docker-Upload-UUID", id)
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// uploadSessionHandler dispatches requests against an existing upload
+// session: PATCH to append a chunk, PUT to finalize, HEAD to query progress.
+func (hs *httpServer) uploadSessionHandler(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/uploads/")
+	if id == "" {
+		hs.startUploadHandler(w, r)
+		return
+	}
+
+	sessVal, ok := hs.uploadSessions.Load(id)
+	if !ok {
+		dfserror.Respond(w, dfserror.UploadSessionExpired, id)
+		return
+	}
+	sess := sessVal.(*uploadSession)
+
+	switch r.Method {
+	case http.MethodPatch:
+		hs.patchUploadHandler(w, r, sess)
+	case http.MethodPut:
+		hs.completeUploadHandler(w, r, sess, id)
+	case http.MethodHead:
+		hs.headUploadHandler(w, sess)
+	default:
+		dfserror.Respond(w, dfserror.MethodNotAllowed, "")
+	}
+}
+
+// patchUploadHandler appends a byte range to the session's staging file and
+// echoes back the bytes received so far via the Range header.
+func (hs *httpServer) patchUploadHandler(w http.ResponseWriter, r *http.Request, sess *uploadSession) {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+
+	start, _, err := parseContentRange(r.Header.Get("Content-Range"))
+	if err != nil {
+		dfserror.Respond(w, dfserror.BadRequest, fmt.Sprintf("invalid Content-Range: %v", err))
+		return
+	}
+	if start != sess.received {
+		dfserror.Respond(w, dfserror.RangeNotSatisfiable, fmt.Sprintf("expected chunk starting at %d, got %d", sess.received, start))
+		return
+	}
+
+	file, err := os.OpenFile(sess.stagingPath, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		dfserror.Respond(w, dfserror.Internal, err.Error())
+		return
+	}
+	defer file.Close()
+
+	n, err := io.Copy(file, r.Body)
+	if err != nil {
+		dfserror.Respond(w, dfserror.Internal, err.Error())
+		return
+	}
+
+	sess.received += n
+	sess.lastActive = time.Now()
+
+	w.Header().Set("Range", fmt.Sprintf("0-%d", sess.received-1))
+	w.Header().Set("Docker-Upload-UUID", sess.id)
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// headUploadHandler lets a client recover the resume offset for a session
+// after a crash, without transferring any data.
+func (hs *httpServer) headUploadHandler(w http.ResponseWriter, sess *uploadSession) {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+
+	w.Header().Set("Range", fmt.Sprintf("0-%d", sess.received-1))
+	w.Header().Set("Docker-Upload-UUID", sess.id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// completeUploadHandler finalizes a session: it verifies the digest, splits
+// the staging file into CAS chunks under dataDir while replicating them to
+// followers, removes the staging file, and then commits the CreateFile
+// command through Raft.
+func (hs *httpServer) completeUploadHandler(w http.ResponseWriter, r *http.Request, sess *uploadSession, id string) {
+	if !hs.raft.IsLeader() {
+		dfserror.Respond(w, dfserror.NotLeader, hs.peerAddresses())
+		return
+	}
+
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+
+	if hs.typeConflict(sess.path, false) {
+		dfserror.Respond(w, dfserror.Conflict, "path already exists as a directory")
+		return
+	}
+
+	if r.ContentLength > 0 {
+		if start, _, err := parseContentRange(r.Header.Get("Content-Range")); err == nil && start == sess.received {
+			file, ferr := os.OpenFile(sess.stagingPath, os.O_WRONLY|os.O_APPEND, 0644)
+			if ferr == nil {
+				n, _ := io.Copy(file, r.Body)
+				file.Close()
+				sess.received += n
+			}
+		}
+	}
+
+	digestParam := r.URL.Query().Get("digest")
+	if digestParam == "" {
+		dfserror.Respond(w, dfserror.BadRequest, "missing required query parameter: digest")
+		return
+	}
+	expectedSum := strings.TrimPrefix(digestParam, "sha256:")
+
+	actualSum, err := sha256File(sess.stagingPath)
+	if err != nil {
+		dfserror.Respond(w, dfserror.Internal, err.Error())
+		return
+	}
+	if actualSum != expectedSum {
+		dfserror.Respond(w, dfserror.DigestMismatch, fmt.Sprintf("expected %s, got %s", expectedSum, actualSum))
+		return
+	}
+
+	stagingFile, err := os.Open(sess.stagingPath)
+	if err != nil {
+		dfserror.Respond(w, dfserror.Internal, err.Error())
+		return
+	}
+	manifest, size, err := hs.ingestAndReplicate(sess.path, stagingFile)
+	stagingFile.Close()
+	if err != nil {
+		dfserror.Respond(w, dfserror.Internal, err.Error())
+		return
+	}
+	os.Remove(sess.stagingPath)
+
+	chunkBytes, err := hexChunksToBytes(manifest)
+	if err != nil {
+		dfserror.Respond(w, dfserror.Internal, err.Error())
+		return
+	}
+
+	cmd := command{
+		Kind:   CreateFile,
+		Path:   sess.path,
+		Size:   size,
+		Chunks: chunkBytes,
+	}
+	if _, err := hs.raft.Apply([][]byte{encodeCommand(cmd)}); err != nil {
+		log.Printf("Raft Apply error: %s", err)
+		dfserror.Respond(w, dfserror.Internal, err.Error())
+		return
+	}
+
+	hs.uploadSessions.Delete(id)
+
+	w.WriteHeader(http.StatusCreated)
+	fmt.Fprintf(w, "File '%s' created and replicated successfully (%d bytes)", sess.path, size)
+}
+
+// reapIdleUploads periodically discards upload sessions that have not seen a
+// PATCH in uploadSessionIdleTimeout, freeing their staging files.
+func (hs *httpServer) reapIdleUploads() {
+	ticker := time.NewTicker(uploadReapInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		now := time.Now()
+		hs.uploadSessions.Range(func(key, value interface{}) bool {
+			sess := value.(*uploadSession)
+
+			sess.mu.Lock()
+			idle := now.Sub(sess.lastActive)
+			sess.mu.Unlock()
+
+			if idle > uploadSessionIdleTimeout {
+				hs.uploadSessions.Delete(key)
+				if err := os.Remove(sess.stagingPath); err != nil && !os.IsNotExist(err) {
+					log.Printf("Failed to remove expired upload staging file %s: %v", sess.stagingPath, err)
+				}
+				log.Printf("Reaped expired upload session %s", sess.id)
+			}
+			return true
+		})
+	}
+}
+
+// antiEntropyLoop periodically runs runAntiEntropy on a ticker until the
+// process exits.
+func (hs *httpServer) antiEntropyLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		hs.runAntiEntropy()
+	}
+}
+
+// runAntiEntropy compares every file this node's state machine knows about
+// against its local blob store and repairs any chunk that's missing from a
+// peer. It only runs on followers: the leader is the source of replication
+// and shouldn't need to repair itself from nodes that are copying from it.
+func (hs *httpServer) runAntiEntropy() {
+	if hs.raft.IsLeader() {
+		return
+	}
+
+	var pending int
+	hs.stateMachine.files.Range(func(key, value interface{}) bool {
+		file, ok := value.(*File)
+		if !ok {
+			return true // directory marker, nothing to repair
+		}
+		for _, hash := range file.Chunks {
+			if chunkExists(hs.dataDir, hash) {
+				continue
+			}
+			pending++
+
+			data, err := hs.fetchChunkFromPeers(hash)
+			if err != nil {
+				log.Printf("Anti-entropy failed to repair chunk %s of %s: %v", hash, file.Name, err)
+				continue
+			}
+			if _, err := writeChunk(hs.dataDir, data); err != nil {
+				log.Printf("Anti-entropy failed to store repaired chunk %s of %s: %v", hash, file.Name, err)
+				continue
+			}
+			hs.repair.recordRepair()
+			pending--
+			log.Printf("Anti-entropy repaired chunk %s for %s from a peer", hash, file.Name)
+		}
+		return true
+	})
+
+	hs.repair.recordRun(pending)
+}
+
+// repairStatusHandler answers GET /repair/status with a snapshot of this
+// node's read-repair and anti-entropy activity.
+func (hs *httpServer) repairStatusHandler(w http.ResponseWriter, r *http.Request) {
+	pending, lastRunAt, lastRepairAt := hs.repair.snapshot()
+
+	resp := struct {
+		PendingRepairs int       `json:"pending_repairs"`
+		LastRunAt      time.Time `json:"last_run_at"`
+		LastRepairAt   time.Time `json:"last_repair_at"`
+	}{
+		PendingRepairs: pending,
+		LastRunAt:      lastRunAt,
+		LastRepairAt:   lastRepairAt,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (hs *httpServer) getFileHandler(w http.ResponseWriter, r *http.Request) {
+	filePath := strings.TrimPrefix(r.URL.Path, "/upload/")
+	log.Printf("Received GetFile request for %s", filePath)
+
+	val, ok := hs.stateMachine.files.Load(filePath)
+	if !ok {
+		dfserror.Respond(w, dfserror.FileNotFound, filePath)
+		return
+	}
+	file, ok := val.(*File)
+	if !ok {
+		dfserror.Respond(w, dfserror.BadRequest, "path is a directory")
+		return
+	}
+
+	// Verify every chunk is available before writing anything to the
+	// response, so a mid-stream miss can't leave a 200 response truncated.
+	for _, hash := range file.Chunks {
+		if _, cached := hs.chunkCache.get(hash); cached {
+			continue
+		}
+		if !chunkExists(hs.dataDir, hash) {
+			// This node is missing a chunk it should have. Rather than fail the
+			// read outright, try to repair it from a peer that still has it.
+			data, err := hs.fetchChunkFromPeers(hash)
+			if err != nil {
+				log.Printf("Read-repair failed for chunk %s of %s: %v", hash, filePath, err)
+				dfserror.Respond(w, dfserror.ChunkMissing, hash)
+				return
+			}
+			if _, err := writeChunk(hs.dataDir, data); err != nil {
+				log.Printf("Error storing repaired chunk %s for %s: %v", hash, filePath, err)
+				dfserror.Respond(w, dfserror.ChunkMissing, hash)
+				return
+			}
+			hs.repair.recordRepair()
+			log.Printf("Read-repaired chunk %s for %s from a peer", hash, filePath)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+
+	var cachedBytes int64
+	for _, hash := range file.Chunks {
+		data, ok := hs.chunkCache.get(hash)
+		if !ok {
+			var err error
+			data, err = readChunk(hs.dataDir, hash)
+			if err != nil {
+				log.Printf("Error reading chunk %s for %s: %v", hash, filePath, err)
+				return
+			}
+			if cachedBytes < perFileCacheCapacityBytes {
+				hs.chunkCache.put(hash, data)
+				cachedBytes += int64(len(data))
+			}
+		}
+		if _, err := w.Write(data); err != nil {
+			log.Printf("Error writing chunk %s to response for %s: %v", hash, filePath, err)
+			return
+		}
+	}
+}
+
+// replicateFileHandler streams a replicated file's content straight into the
+// CAS blob store as it arrives, then checks the trailing digest the leader
+// stamped on once the whole body had been read.
+func (hs *httpServer) replicateFileHandler(w http.ResponseWriter, r *http.Request) {
+	filePath := strings.TrimPrefix(r.URL.Path, "/replicate/")
+	log.Printf("Received replication request for %s", filePath)
+
+	hasher := sha256.New()
+	manifest, size, err := splitAndStoreChunks(hs.dataDir, io.TeeReader(r.Body, hasher))
+	if err != nil {
+		dfserror.Respond(w, dfserror.Internal, err.Error())
+		return
+	}
+
+	if expected := r.Trailer.Get(replicationTrailerKey); expected != "" {
+		actual := hex.EncodeToString(hasher.Sum(nil))
+		if actual != expected {
+			dfserror.Respond(w, dfserror.DigestMismatch, fmt.Sprintf("expected %s, got %s", expected, actual))
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "Replicated %d chunk(s) (%d bytes) for '%s'", len(manifest), size, filePath)
+}
+
+func (hs *httpServer) uploadHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		hs.getFileHandler(w, r)
+	case http.MethodPost:
+		hs.createFileHandler(w, r)
+	case "COPY":
+		hs.copyHandler(w, r)
+	case "MOVE":
+		hs.moveHandler(w, r)
+	default:
+		dfserror.Respond(w, dfserror.MethodNotAllowed, "")
+	}
+}
+
+type config struct {
+	cluster []goraft.ClusterMember
+	index   int
+	http    string
+}
+
+func getConfig() config {
+	cfg := config{}
+	var node string
+
+	for i := 0; i < len(os.Args)-1; i++ {
+		arg := os.Args[i]
+
+		if arg == "--node" {
+			var err error
+			node = os.Args[i+1]
+			cfg.index, err = strconv.Atoi(node)
+			if err != nil {
+				log.Fatalf("Expected integer for --node, got: %s", node)
+			}
+			i++
+			continue
+		}
+
+		if arg == "--http" {
+			cfg.http = os.Args[i+1]
+			i++
+			continue
+		}
+
+		if arg == "--cluster" {
+			cluster := os.Args[i+1]
+			for _, part := range strings.Split(cluster, ";") {
+				details := strings.Split(part, ",")
+				if len(details) != 3 {
+					log.Fatalf("Invalid cluster format. Expected: id,rpc_address,http_address")
+				}
+
+				var clusterEntry goraft.ClusterMember
+				var err error
+				clusterEntry.Id, err = strconv.ParseUint(details[0], 10, 64)
+				if err != nil {
+					log.Fatalf("Expected integer for cluster ID, got: %s", details[0])
+				}
+				clusterEntry.Address = details[1]
+				clusterEntry.HttpAddress = details[2]
+				cfg.cluster = append(cfg.cluster, clusterEntry)
+			}
+			i++
+			continue
+		}
+	}
+
+	if node == "" {
+		log.Fatal("Missing required parameter: --node <index>")
+	}
+	if cfg.http == "" {
+		log.Fatal("Missing required parameter: --http <address>")
+	}
+	if len(cfg.cluster) == 0 {
+		log.Fatal("Missing required parameter: --cluster <id1,addr1;id2,addr2;...>")
+	}
+
+	return cfg
+}
+
+func main() {
+	var b [8]byte
+	_, err := crypto.Read(b[:])
+	if err != nil {
+		panic("cannot seed math/rand package with cryptographically secure random number generator")
+	}
+	rand.Seed(int64(binary.LittleEndian.Uint64(b[:])))
+
+	cfg := getConfig()
+
+	// Create a unique data directory for each node
 	dataDir := fmt.Sprintf("./data-%d", cfg.index)
 	os.MkdirAll(dataDir, 0755)
 
@@ -387,18 +1851,37 @@ func main() {
 	// Give Raft time to start up and elect a leader
 	time.Sleep(500 * time.Millisecond)
 
+	var peers []goraft.ClusterMember
+	for _, member := range cfg.cluster {
+		if member.Id != s.Id() {
+			peers = append(peers, member)
+		}
+	}
+
 	hs := &httpServer{
-		raft:         s,
-		stateMachine: sm,
-		dataDir:      dataDir,
+		raft:           s,
+		stateMachine:   sm,
+		dataDir:        dataDir,
+		peers:          peers,
+		uploadSessions: &sync.Map{},
+		chunkCache:     newChunkCache(chunkCacheCapacityBytes),
+		repair:         &repairStats{},
 	}
+	go hs.reapIdleUploads()
+	go hs.antiEntropyLoop(antiEntropyInterval)
 
 	// Use a dedicated mux for each server instance to avoid global state conflicts.
 	mux := http.NewServeMux()
 	mux.HandleFunc("/status", hs.statusHandler)
 	mux.HandleFunc("/files", hs.listFilesHandler)
+	mux.HandleFunc("/files/", hs.propfindHandler) // PROPFIND directory listings
 	mux.HandleFunc("/replicate/", hs.replicateFileHandler)
-	mux.HandleFunc("/upload/", hs.uploadHandler) // Combined handler for GET and POST
+	mux.HandleFunc("/upload/", hs.uploadHandler)         // Combined handler for GET, POST, COPY, MOVE
+	mux.HandleFunc("/uploads/", hs.uploadSessionHandler) // Resumable chunked uploads
+	mux.HandleFunc("/chunks/missing", hs.chunksMissingHandler)
+	mux.HandleFunc("/blobs/", hs.blobFetchHandler)
+	mux.HandleFunc("/repair/status", hs.repairStatusHandler)
+	mux.HandleFunc("/dirs/", hs.dirHandler)
 
 	log.Printf("Node %d starting HTTP server on %s", s.Id(), cfg.http)
 	log.Printf("Cluster: %d nodes", len(cfg.cluster))
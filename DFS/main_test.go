@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+func TestEncodeDecodeCommandRoundTrip(t *testing.T) {
+	cases := []command{
+		{Kind: CreateFile, Path: "/a/b.txt", Size: 42, Chunks: [][]byte{{0x01, 0x02}, {0x03}}},
+		{Kind: DeleteFile, Path: "/a/b.txt"},
+		{Kind: RenameFile, OldPath: "/a/b.txt", NewPath: "/a/c.txt", Size: 7},
+		{Kind: MkDir, Path: "/a"},
+		{Kind: RmDir, Path: "/a"},
+		{Kind: CopyDir, OldPath: "/a", NewPath: "/b"},
+		{Kind: CreateFile, Path: "/empty", Chunks: [][]byte{}},
+	}
+
+	for _, c := range cases {
+		got := decodeCommand(encodeCommand(c))
+		if got.Kind != c.Kind || got.Path != c.Path || got.OldPath != c.OldPath || got.NewPath != c.NewPath || got.Size != c.Size {
+			t.Fatalf("round trip mismatch: got %+v, want %+v", got, c)
+		}
+		if len(got.Chunks) != len(c.Chunks) {
+			t.Fatalf("round trip chunk count mismatch: got %d, want %d", len(got.Chunks), len(c.Chunks))
+		}
+		for i := range c.Chunks {
+			if !bytes.Equal(got.Chunks[i], c.Chunks[i]) {
+				t.Fatalf("round trip chunk %d mismatch: got %x, want %x", i, got.Chunks[i], c.Chunks[i])
+			}
+		}
+	}
+}
+
+func TestSplitAndStoreChunksBoundaries(t *testing.T) {
+	dataDir := t.TempDir()
+
+	cases := []struct {
+		name       string
+		size       int
+		wantChunks int
+	}{
+		{"empty", 0, 0},
+		{"smaller than chunk", chunkSize - 1, 1},
+		{"exact chunk", chunkSize, 1},
+		{"chunk plus one byte", chunkSize + 1, 2},
+		{"two exact chunks", chunkSize * 2, 2},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			data := make([]byte, tc.size)
+			for i := range data {
+				data[i] = byte(i)
+			}
+
+			manifest, size, err := splitAndStoreChunks(dataDir, bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("splitAndStoreChunks: %v", err)
+			}
+			if size != int64(tc.size) {
+				t.Fatalf("size = %d, want %d", size, tc.size)
+			}
+			if len(manifest) != tc.wantChunks {
+				t.Fatalf("manifest has %d chunks, want %d", len(manifest), tc.wantChunks)
+			}
+
+			var reassembled []byte
+			for _, hash := range manifest {
+				chunk, err := readChunk(dataDir, hash)
+				if err != nil {
+					t.Fatalf("readChunk(%s): %v", hash, err)
+				}
+				reassembled = append(reassembled, chunk...)
+			}
+			if !bytes.Equal(reassembled, data) {
+				t.Fatalf("reassembled data does not match original")
+			}
+		})
+	}
+}
+
+func TestWriteChunkDedupsIdenticalContent(t *testing.T) {
+	dataDir := t.TempDir()
+	data := []byte("identical content")
+
+	hash1, err := writeChunk(dataDir, data)
+	if err != nil {
+		t.Fatalf("writeChunk: %v", err)
+	}
+	hash2, err := writeChunk(dataDir, data)
+	if err != nil {
+		t.Fatalf("writeChunk: %v", err)
+	}
+	if hash1 != hash2 {
+		t.Fatalf("hashes differ for identical content: %s vs %s", hash1, hash2)
+	}
+
+	path := blobPath(dataDir, hash1)
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("stat blob: %v", err)
+	}
+}
+
+func TestChunkCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	c := newChunkCache(10)
+
+	c.put("a", make([]byte, 4))
+	c.put("b", make([]byte, 4))
+
+	// Touch "a" so "b" becomes the least recently used entry.
+	if _, ok := c.get("a"); !ok {
+		t.Fatalf("expected a to be cached")
+	}
+
+	// Pushes size to 12, over the capacity of 10, evicting the LRU entry ("b").
+	c.put("c", make([]byte, 4))
+
+	if _, ok := c.get("b"); ok {
+		t.Fatalf("expected b to have been evicted")
+	}
+	if _, ok := c.get("a"); !ok {
+		t.Fatalf("expected a to still be cached")
+	}
+	if _, ok := c.get("c"); !ok {
+		t.Fatalf("expected c to be cached")
+	}
+	if c.size > c.capacity {
+		t.Fatalf("cache size %d exceeds capacity %d", c.size, c.capacity)
+	}
+}
+
+func TestIsValidChunkHash(t *testing.T) {
+	validHash := "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+
+	cases := []struct {
+		hash string
+		want bool
+	}{
+		{"", false},
+		{"a", false},
+		{validHash[:len(validHash)-1], false},
+		{validHash + "a", false},
+		{validHash[:len(validHash)-1] + "Z", false},
+		{validHash, true},
+	}
+
+	for _, tc := range cases {
+		if got := isValidChunkHash(tc.hash); got != tc.want {
+			t.Errorf("isValidChunkHash(%q) = %v, want %v", tc.hash, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+// Package dfsclient provides a small HTTP client helper for talking to a DFS
+// cluster without the caller needing to guess which node is the leader.
+package dfsclient
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"distributed-file-system/dfserror"
+)
+
+// maxRedirects bounds how many NotLeader hops Do will follow before giving
+// up, so a cluster stuck in an election can't spin a caller forever.
+const maxRedirects = 5
+
+// Do sends req and, if the node answers with a dfserror.NotLeader error,
+// retries against the candidate addresses carried in the error's Cause field
+// until one of them answers with something other than NotLeader.
+//
+// goraft.Server doesn't expose which peer is the current leader to a
+// follower, so NotLeader's Cause is a comma-separated list of peer addresses
+// rather than a single authoritative one - Do tries each in turn. Requests
+// with a body must set req.GetBody (as http.NewRequest does for common body
+// types) so a retry can resend it.
+func Do(client *http.Client, req *http.Request) (*http.Response, error) {
+	tried := map[string]bool{req.URL.Host: true}
+
+	for attempt := 0; attempt < maxRedirects; attempt++ {
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+
+		if resp.StatusCode != http.StatusServiceUnavailable {
+			return resp, nil
+		}
+
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		var dfsErr dfserror.Error
+		if jsonErr := json.Unmarshal(body, &dfsErr); jsonErr != nil || dfsErr.Code != dfserror.NotLeader {
+			resp.Body = io.NopCloser(bytes.NewReader(body))
+			return resp, nil
+		}
+
+		next := nextCandidate(dfsErr.Cause, tried)
+		if next == "" {
+			resp.Body = io.NopCloser(bytes.NewReader(body))
+			return resp, fmt.Errorf("dfsclient: no untried peers left in NotLeader response")
+		}
+		tried[next] = true
+
+		req, err = redirectTo(req, next)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return nil, fmt.Errorf("dfsclient: gave up after %d NotLeader redirects", maxRedirects)
+}
+
+// nextCandidate returns the first address in cause that hasn't been tried.
+func nextCandidate(cause string, tried map[string]bool) string {
+	for _, addr := range strings.Split(cause, ",") {
+		addr = strings.TrimSpace(addr)
+		if addr != "" && !tried[addr] {
+			return addr
+		}
+	}
+	return ""
+}
+
+// redirectTo builds a copy of req pointed at addr, replaying the body via
+// GetBody if the original request had one.
+func redirectTo(req *http.Request, addr string) (*http.Request, error) {
+	next := req.Clone(req.Context())
+	next.URL.Host = addr
+	next.Host = addr
+
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		next.Body = body
+	}
+
+	return next, nil
+}
@@ -0,0 +1,107 @@
+// Package dfserror defines the structured error codes the DFS HTTP API
+// returns, modeled on etcd's error-code table: codes are assigned explicit
+// numeric values (not iota) so inserting a new one never renumbers a code a
+// client might already be matching on.
+package dfserror
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// Code is a stable, wire-compatible error code.
+type Code int
+
+const (
+	// 100s: cluster topology and routing.
+	NotLeader   Code = 100
+	ClusterFull Code = 101
+
+	// 200s: resource lookup failures.
+	FileNotFound Code = 200
+	ChunkMissing Code = 201
+
+	// 300s: request validation and state conflicts.
+	BadRequest          Code = 300
+	MethodNotAllowed    Code = 301
+	RangeNotSatisfiable Code = 302
+	Conflict            Code = 303
+
+	// 400s: upload lifecycle.
+	UploadSessionExpired Code = 400
+	DigestMismatch       Code = 401
+
+	// 500s: failures not attributable to the caller.
+	Internal Code = 500
+)
+
+var messages = map[Code]string{
+	NotLeader:            "not the leader",
+	ClusterFull:          "cluster is full",
+	FileNotFound:         "file not found",
+	ChunkMissing:         "chunk not found on this node",
+	BadRequest:           "invalid request",
+	MethodNotAllowed:     "method not allowed",
+	RangeNotSatisfiable:  "requested range not satisfiable",
+	Conflict:             "request conflicts with current state",
+	UploadSessionExpired: "upload session not found or expired",
+	DigestMismatch:       "content digest mismatch",
+	Internal:             "internal error",
+}
+
+var statuses = map[Code]int{
+	NotLeader:            http.StatusServiceUnavailable,
+	ClusterFull:          http.StatusInsufficientStorage,
+	FileNotFound:         http.StatusNotFound,
+	ChunkMissing:         http.StatusNotFound,
+	BadRequest:           http.StatusBadRequest,
+	MethodNotAllowed:     http.StatusMethodNotAllowed,
+	RangeNotSatisfiable:  http.StatusRequestedRangeNotSatisfiable,
+	Conflict:             http.StatusConflict,
+	UploadSessionExpired: http.StatusNotFound,
+	DigestMismatch:       http.StatusConflict,
+	Internal:             http.StatusInternalServerError,
+}
+
+// Error is the JSON body every DFS HTTP handler writes alongside its status
+// code. Cause carries instance-specific detail - for NotLeader, the peer
+// addresses a client can retry against.
+type Error struct {
+	Code    Code   `json:"errorCode"`
+	Message string `json:"message"`
+	Cause   string `json:"cause,omitempty"`
+}
+
+// New builds an Error for code, filling in its standard message.
+func New(code Code, cause string) *Error {
+	return &Error{Code: code, Message: messages[code], Cause: cause}
+}
+
+func (e *Error) Error() string {
+	if e.Cause == "" {
+		return e.Message
+	}
+	return fmt.Sprintf("%s: %s", e.Message, e.Cause)
+}
+
+// Status returns the HTTP status code associated with e.Code, defaulting to
+// 500 for a code this version of the package doesn't recognize.
+func (e *Error) Status() int {
+	if status, ok := statuses[e.Code]; ok {
+		return status
+	}
+	return http.StatusInternalServerError
+}
+
+// Write sends e as a JSON body with its associated HTTP status.
+func (e *Error) Write(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(e.Status())
+	json.NewEncoder(w).Encode(e)
+}
+
+// Respond is shorthand for New(code, cause).Write(w).
+func Respond(w http.ResponseWriter, code Code, cause string) {
+	New(code, cause).Write(w)
+}